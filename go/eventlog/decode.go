@@ -0,0 +1,195 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// Indices into the EvtVariant slice returned by rendering with
+// EvtRenderContextSystem, in the fixed order defined by EVT_SYSTEM_PROPERTY_ID.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_system_property_id
+const (
+	evtSystemProviderName = iota
+	evtSystemProviderGuid
+	evtSystemEventID
+	evtSystemQualifiers
+	evtSystemLevel
+	evtSystemTask
+	evtSystemOpcode
+	evtSystemKeywords
+	evtSystemTimeCreated
+	evtSystemEventRecordID
+	evtSystemActivityID
+	evtSystemRelatedActivityID
+	evtSystemProcessID
+	evtSystemThreadID
+	evtSystemChannel
+	evtSystemComputer
+	evtSystemUserID
+	evtSystemVersion
+	evtSystemPropertyIDEnd
+)
+
+// SystemProperties holds the common fields present on every event, under the
+// System element of the event's XML. Callers who only need these fields can
+// use DecodeSystem to skip the full XML parse path entirely -- the same
+// optimization the OTel collector adopted when it stopped rendering full XML
+// just to extract the provider name.
+type SystemProperties struct {
+	ProviderName      string
+	ProviderGUID      windows.GUID
+	EventID           uint16
+	Version           uint8
+	Level             uint8
+	Task              uint16
+	Opcode            uint8
+	Keywords          uint64
+	TimeCreated       time.Time
+	EventRecordID     uint64
+	ActivityID        windows.GUID
+	RelatedActivityID windows.GUID
+	ProcessID         uint32
+	ThreadID          uint32
+	Channel           string
+	Computer          string
+	UserID            *windows.SID
+}
+
+// DecodeSystem renders evt's System properties and unmarshals them into a
+// SystemProperties struct.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_render_context_flags
+func DecodeSystem(evt Event) (*SystemProperties, error) {
+	ctx, err := CreateRenderContext(EvtRenderContextSystem, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CreateRenderContext(EvtRenderContextSystem): %w", err)
+	}
+	defer ctx.Close()
+
+	vs, err := Render(ctx, evt, EvtRenderEventValues)
+	if err != nil {
+		return nil, fmt.Errorf("Render: %w", err)
+	}
+	if len(vs) < evtSystemPropertyIDEnd {
+		return nil, fmt.Errorf("Render returned %d system values, want %d", len(vs), evtSystemPropertyIDEnd)
+	}
+
+	sp := &SystemProperties{
+		ProviderName:      vs[evtSystemProviderName].Data.StringVal,
+		ProviderGUID:      vs[evtSystemProviderGuid].Data.GuidVal,
+		EventID:           vs[evtSystemEventID].Data.UInt16Val,
+		Version:           vs[evtSystemVersion].Data.ByteVal,
+		Level:             vs[evtSystemLevel].Data.ByteVal,
+		Task:              vs[evtSystemTask].Data.UInt16Val,
+		Opcode:            vs[evtSystemOpcode].Data.ByteVal,
+		Keywords:          vs[evtSystemKeywords].Data.UInt64Val,
+		TimeCreated:       filetimeToTime(vs[evtSystemTimeCreated].Data.FileTimeVal),
+		EventRecordID:     vs[evtSystemEventRecordID].Data.UInt64Val,
+		ActivityID:        vs[evtSystemActivityID].Data.GuidVal,
+		RelatedActivityID: vs[evtSystemRelatedActivityID].Data.GuidVal,
+		ProcessID:         vs[evtSystemProcessID].Data.UInt32Val,
+		ThreadID:          vs[evtSystemThreadID].Data.UInt32Val,
+		Channel:           vs[evtSystemChannel].Data.StringVal,
+		Computer:          vs[evtSystemComputer].Data.StringVal,
+	}
+	if vs[evtSystemUserID].Type == EvtVarTypeSid {
+		sp.UserID = vs[evtSystemUserID].Data.SidVal
+	}
+	return sp, nil
+}
+
+// eventDataXML models the <EventData>/<UserData> element of an event's
+// rendered XML, used by DecodeUserData to recover the name of each value --
+// information that EvtRenderContextUser's positional EvtVariant array does
+// not carry on its own. <EventData> values carry their name in a Name
+// attribute; <UserData> is arbitrary provider-defined XML with no fixed
+// schema, but in practice its value carries its name in the element's own
+// tag, e.g. <UserData><MyEvent><ProcessId>1234</ProcessId></MyEvent></UserData>.
+type eventDataXML struct {
+	EventData struct {
+		Data []struct {
+			Name  string `xml:"Name,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Data"`
+	} `xml:"EventData"`
+	UserData struct {
+		Data struct {
+			Fields []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+			} `xml:",any"`
+		} `xml:",any"`
+	} `xml:"UserData"`
+}
+
+// names returns the recovered value names, in the same order as the
+// EvtVariant array Render produces for EvtRenderContextUser, from whichever
+// of EventData or UserData the event actually used.
+func (x eventDataXML) names() []string {
+	names := make([]string, 0, len(x.EventData.Data)+len(x.UserData.Data.Fields))
+	for _, d := range x.EventData.Data {
+		names = append(names, d.Name)
+	}
+	for _, f := range x.UserData.Data.Fields {
+		names = append(names, f.XMLName.Local)
+	}
+	return names
+}
+
+// DecodeUserData renders evt's user-defined properties (the UserData or
+// EventData element) into a map keyed by each value's name: the Name
+// attribute of an <EventData> value, or the element tag of a <UserData> value.
+// A value whose name cannot be recovered is keyed by its position, as "Data0",
+// "Data1", and so on.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_render_context_flags
+func DecodeUserData(evt Event) (map[string]EvtVariant, error) {
+	ctx, err := CreateRenderContext(EvtRenderContextUser, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CreateRenderContext(EvtRenderContextUser): %w", err)
+	}
+	defer ctx.Close()
+
+	vs, err := Render(ctx, evt, EvtRenderEventValues)
+	if err != nil {
+		return nil, fmt.Errorf("Render: %w", err)
+	}
+
+	raw, err := RenderXML(evt)
+	if err != nil {
+		return nil, fmt.Errorf("RenderXML: %w", err)
+	}
+	var parsed eventDataXML
+	if err := xml.Unmarshal([]byte(raw), &parsed); err != nil {
+		return nil, fmt.Errorf("xml.Unmarshal: %w", err)
+	}
+	names := parsed.names()
+
+	out := make(map[string]EvtVariant, len(vs))
+	for i, v := range vs {
+		name := fmt.Sprintf("Data%d", i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		out[name] = v
+	}
+	return out, nil
+}
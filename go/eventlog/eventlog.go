@@ -119,7 +119,6 @@ const (
 func CreateRenderContext(flags EvtRenderContextFlags, valuePaths *[]string) (RenderContext, error) {
 	rc := RenderContext{}
 
-	pathsPtr := uintptr(0)
 	p := []*uint16{}
 	if valuePaths != nil {
 		for _, v := range *valuePaths {
@@ -129,11 +128,18 @@ func CreateRenderContext(flags EvtRenderContextFlags, valuePaths *[]string) (Ren
 			}
 			p = append(p, ptr)
 		}
-		pathsPtr = uintptr(unsafe.Pointer(&p[0]))
 	}
 
+	// &p[0] is converted to a uintptr directly in the call expression below,
+	// rather than being stashed in a local variable first: the Go garbage
+	// collector is free to move or reclaim p as soon as it is no longer
+	// referenced by a pointer, and a uintptr does not keep it alive.
 	var err error
-	rc.handle, err = wevtapi.EvtCreateRenderContext(uint32(len(p)), uintptr(pathsPtr), uint32(flags))
+	if len(p) > 0 {
+		rc.handle, err = wevtapi.EvtCreateRenderContext(uint32(len(p)), uintptr(unsafe.Pointer(&p[0])), uint32(flags))
+	} else {
+		rc.handle, err = wevtapi.EvtCreateRenderContext(0, 0, uint32(flags))
+	}
 	return rc, err
 }
 
@@ -221,6 +227,11 @@ func Query(session *Session, path string, query string, flags uint32) (ResultSet
 
 // EvtVariantData models the union inside of the EVT_VARIANT structure.
 //
+// SidVal and SidArr hold pointers into the buffer the EvtVariant was decoded
+// from rather than copies: windows.SID is an opaque, variable-length type
+// (declared as a zero-size marker struct in x/sys/windows), so a value copy
+// would only copy the marker, not the underlying SID bytes.
+//
 // Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ns-winevt-evt_variant
 type EvtVariantData struct {
 	BooleanVal    bool
@@ -239,8 +250,8 @@ type EvtVariantData struct {
 	GuidVal       windows.GUID
 	StringVal     string
 	AnsiStringVal string
-	BinaryVal     byte
-	SidVal        windows.SID
+	BinaryVal     []byte
+	SidVal        *windows.SID
 	SizeTVal      uint32
 	BooleanArr    *[]bool
 	SByteArr      *[]int8
@@ -258,7 +269,7 @@ type EvtVariantData struct {
 	GuidArr       *[]windows.GUID
 	StringArr     *[]string
 	AnsiStringArr *[]string
-	SidArr        *[]windows.SID
+	SidArr        *[]*windows.SID
 	SizeTArr      *[]uint32
 	EvtHandleVal  windows.Handle
 	XmlVal        string
@@ -0,0 +1,162 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"fmt"
+	"time"
+
+	"golang.org/x/sys/windows"
+	"github.com/google/winops/winlog/wevtapi"
+)
+
+// A LogHandle is a Handle to a channel or log file opened by OpenLog, for use
+// with GetLogInfo.
+type LogHandle Handle
+
+// Close releases a LogHandle.
+func (h *LogHandle) Close() {
+	if h != nil {
+		wevtapi.EvtClose(h.handle)
+	}
+}
+
+// EvtLogPropertyID (EVT_LOG_PROPERTY_ID) identifies a property of a channel or
+// log file, for use with GetLogInfo.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_log_property_id
+type EvtLogPropertyID uint32
+
+const (
+	// EvtLogCreationTime is the time the log was created, as a FILETIME.
+	EvtLogCreationTime EvtLogPropertyID = iota
+	// EvtLogLastAccessTime is the time the log was last accessed, as a FILETIME.
+	EvtLogLastAccessTime
+	// EvtLogLastWriteTime is the time the log was last written to, as a FILETIME.
+	EvtLogLastWriteTime
+	// EvtLogFileSize is the size of the log file, in bytes.
+	EvtLogFileSize
+	// EvtLogAttributes specifies whether the log file is archived.
+	EvtLogAttributes
+	// EvtLogNumberOfLogRecords is the number of records in the log.
+	EvtLogNumberOfLogRecords
+	// EvtLogOldestRecordNumber is the oldest record number in the log.
+	EvtLogOldestRecordNumber
+	// EvtLogFull indicates whether the log file is full.
+	EvtLogFull
+)
+
+// OpenLog opens a Handle to the channel or log file named by path, for use
+// with GetLogInfo. Set flags to wevtapi.EvtOpenChannelPath or
+// wevtapi.EvtOpenFilePath depending on whether path names a live channel or an
+// archived .evtx file.
+//
+// Session is only required for remote connections; leave as nil for the local
+// computer.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtopenlog
+func OpenLog(session *Session, path string, flags uint32) (*LogHandle, error) {
+	l := &LogHandle{}
+
+	var s windows.Handle
+	if session != nil {
+		s = session.handle
+	}
+
+	var err error
+	l.handle, err = wevtapi.EvtOpenLog(s, windows.StringToUTF16Ptr(path), flags)
+	if err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtOpenLog(%s): %w", path, err)
+	}
+	return l, nil
+}
+
+// GetLogInfo retrieves a single property of log, such as its FileSize or
+// OldestRecordNumber.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtgetloginfo
+func GetLogInfo(log *LogHandle, id EvtLogPropertyID) (EvtVariant, error) {
+	var bufferUsed uint32
+	err := wevtapi.EvtGetLogInfo(log.handle, uint32(id), 0, nil, &bufferUsed)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetLogInfo (probe): %w", err)
+	}
+
+	buf := make([]byte, bufferUsed)
+	if err := wevtapi.EvtGetLogInfo(log.handle, uint32(id), uint32(len(buf)), &buf[0], &bufferUsed); err != nil {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetLogInfo: %w", err)
+	}
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		return EvtVariant{}, err
+	}
+	return vs[0], nil
+}
+
+// LogInfo summarizes the health of a channel or log file, as reported by
+// `wevtutil gl`.
+type LogInfo struct {
+	CreationTime       time.Time
+	LastAccessTime     time.Time
+	LastWriteTime      time.Time
+	FileSize           uint64
+	Attributes         uint32
+	NumberOfLogRecords uint32
+	OldestRecordNumber uint32
+	Full               bool
+}
+
+// epochDelta100ns is the number of 100-nanosecond intervals between the
+// Windows FILETIME epoch (1601-01-01) and the Unix epoch (1970-01-01).
+const epochDelta100ns = 116444736000000000
+
+// filetimeToTime converts a Windows FILETIME (100-ns intervals since
+// 1601-01-01) to a time.Time.
+func filetimeToTime(ft windows.Filetime) time.Time {
+	ns100 := int64(ft.HighDateTime)<<32 | int64(ft.LowDateTime)
+	return time.Unix(0, (ns100-epochDelta100ns)*100).UTC()
+}
+
+// LogFileInfo opens path and fills an eventlog.LogInfo with all of its
+// EvtLogInfo properties in one call, so operational tooling can report
+// log-file health (size, oldest record, full flag) without shelling out to
+// `wevtutil gl`.
+func LogFileInfo(path string) (*LogInfo, error) {
+	log, err := OpenLog(nil, path, wevtapi.EvtOpenChannelPath)
+	if err != nil {
+		return nil, err
+	}
+	defer log.Close()
+
+	info := &LogInfo{}
+	for id, dst := range map[EvtLogPropertyID]func(EvtVariant){
+		EvtLogCreationTime:       func(v EvtVariant) { info.CreationTime = filetimeToTime(v.Data.FileTimeVal) },
+		EvtLogLastAccessTime:     func(v EvtVariant) { info.LastAccessTime = filetimeToTime(v.Data.FileTimeVal) },
+		EvtLogLastWriteTime:      func(v EvtVariant) { info.LastWriteTime = filetimeToTime(v.Data.FileTimeVal) },
+		EvtLogFileSize:           func(v EvtVariant) { info.FileSize = v.Data.UInt64Val },
+		EvtLogAttributes:         func(v EvtVariant) { info.Attributes = v.Data.UInt32Val },
+		EvtLogNumberOfLogRecords: func(v EvtVariant) { info.NumberOfLogRecords = v.Data.UInt32Val },
+		EvtLogOldestRecordNumber: func(v EvtVariant) { info.OldestRecordNumber = v.Data.UInt32Val },
+		EvtLogFull:               func(v EvtVariant) { info.Full = v.Data.BooleanVal },
+	} {
+		v, err := GetLogInfo(log, id)
+		if err != nil {
+			return nil, fmt.Errorf("GetLogInfo(%s, %d): %w", path, id, err)
+		}
+		dst(v)
+	}
+	return info, nil
+}
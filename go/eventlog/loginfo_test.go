@@ -0,0 +1,42 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+func TestFiletimeToTime(t *testing.T) {
+	want := time.Date(2021, time.March, 15, 12, 30, 0, 0, time.UTC)
+	ft := windows.NsecToFiletime(want.UnixNano())
+
+	got := filetimeToTime(ft)
+	if !got.Equal(want) {
+		t.Errorf("filetimeToTime(%+v) = %v, want %v", ft, got, want)
+	}
+}
+
+func TestFiletimeToTimeUnixEpoch(t *testing.T) {
+	want := time.Unix(0, 0).UTC()
+	ft := windows.NsecToFiletime(0)
+
+	got := filetimeToTime(ft)
+	if !got.Equal(want) {
+		t.Errorf("filetimeToTime(%+v) = %v, want %v", ft, got, want)
+	}
+}
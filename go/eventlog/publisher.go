@@ -0,0 +1,348 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sys/windows"
+	"github.com/google/winops/winlog/wevtapi"
+)
+
+// EvtPublisherMetadataPropertyID (EVT_PUBLISHER_METADATA_PROPERTY_ID) identifies
+// a property of a publisher's metadata, for use with GetPublisherMetadataProperty.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_publisher_metadata_property_id
+type EvtPublisherMetadataPropertyID uint32
+
+const (
+	// EvtPublisherMetadataPublisherGuid is the publisher's GUID.
+	EvtPublisherMetadataPublisherGuid EvtPublisherMetadataPropertyID = iota
+	// EvtPublisherMetadataResourceFilePath is the path to the resource file that contains the message table.
+	EvtPublisherMetadataResourceFilePath
+	// EvtPublisherMetadataParameterFilePath is the path to the file that contains the message table used for parameter substitutions.
+	EvtPublisherMetadataParameterFilePath
+	// EvtPublisherMetadataMessageFilePath is the path to the file that contains the message table for the publisher's event messages.
+	EvtPublisherMetadataMessageFilePath
+	// EvtPublisherMetadataHelpLink is the help link URL for the publisher.
+	EvtPublisherMetadataHelpLink
+	// EvtPublisherMetadataPublisherMessageID is the message identifier for the publisher's display name.
+	EvtPublisherMetadataPublisherMessageID
+	// EvtPublisherMetadataChannelReferences is the array of channels that the publisher defines.
+	EvtPublisherMetadataChannelReferences
+	// EvtPublisherMetadataChannelReferencePath is the resource file path for a channel reference.
+	EvtPublisherMetadataChannelReferencePath
+	// EvtPublisherMetadataChannelReferenceIndex is the index of a channel reference.
+	EvtPublisherMetadataChannelReferenceIndex
+	// EvtPublisherMetadataChannelReferenceID is the identifier of a channel reference.
+	EvtPublisherMetadataChannelReferenceID
+	// EvtPublisherMetadataChannelReferenceFlags specifies whether the channel is imported from another publisher.
+	EvtPublisherMetadataChannelReferenceFlags
+	// EvtPublisherMetadataChannelReferenceMessageID is the message identifier for a channel's display name.
+	EvtPublisherMetadataChannelReferenceMessageID
+	// EvtPublisherMetadataLevels is the array of levels that the publisher defines.
+	EvtPublisherMetadataLevels
+	// EvtPublisherMetadataLevelName is the name of a level.
+	EvtPublisherMetadataLevelName
+	// EvtPublisherMetadataLevelValue is the value of a level.
+	EvtPublisherMetadataLevelValue
+	// EvtPublisherMetadataLevelMessageID is the message identifier for a level's display name.
+	EvtPublisherMetadataLevelMessageID
+	// EvtPublisherMetadataTasks is the array of tasks that the publisher defines.
+	EvtPublisherMetadataTasks
+	// EvtPublisherMetadataTaskName is the name of a task.
+	EvtPublisherMetadataTaskName
+	// EvtPublisherMetadataTaskEventGuid is the GUID of a task.
+	EvtPublisherMetadataTaskEventGuid
+	// EvtPublisherMetadataTaskValue is the value of a task.
+	EvtPublisherMetadataTaskValue
+	// EvtPublisherMetadataTaskMessageID is the message identifier for a task's display name.
+	EvtPublisherMetadataTaskMessageID
+	// EvtPublisherMetadataOpcodes is the array of opcodes that the publisher defines.
+	EvtPublisherMetadataOpcodes
+	// EvtPublisherMetadataOpcodeName is the name of an opcode.
+	EvtPublisherMetadataOpcodeName
+	// EvtPublisherMetadataOpcodeValue is the value of an opcode.
+	EvtPublisherMetadataOpcodeValue
+	// EvtPublisherMetadataOpcodeMessageID is the message identifier for an opcode's display name.
+	EvtPublisherMetadataOpcodeMessageID
+	// EvtPublisherMetadataKeywords is the array of keywords that the publisher defines.
+	EvtPublisherMetadataKeywords
+	// EvtPublisherMetadataKeywordName is the name of a keyword.
+	EvtPublisherMetadataKeywordName
+	// EvtPublisherMetadataKeywordValue is the value of a keyword.
+	EvtPublisherMetadataKeywordValue
+	// EvtPublisherMetadataKeywordMessageID is the message identifier for a keyword's display name.
+	EvtPublisherMetadataKeywordMessageID
+)
+
+// EvtEventMetadataPropertyID (EVT_EVENT_METADATA_PROPERTY_ID) identifies a
+// property of an event definition returned by EvtNextEventMetadata.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winmeta/ne-winmeta-evt_event_metadata_property_id
+type EvtEventMetadataPropertyID uint32
+
+const (
+	// EventMetadataEventID is the event's ID.
+	EventMetadataEventID EvtEventMetadataPropertyID = iota
+	// EventMetadataEventVersion is the event's version.
+	EventMetadataEventVersion
+	// EventMetadataEventChannel is the event's channel.
+	EventMetadataEventChannel
+	// EventMetadataEventLevel is the event's level.
+	EventMetadataEventLevel
+	// EventMetadataEventOpcode is the event's opcode.
+	EventMetadataEventOpcode
+	// EventMetadataEventTask is the event's task.
+	EventMetadataEventTask
+	// EventMetadataEventKeyword is the event's keyword.
+	EventMetadataEventKeyword
+	// EventMetadataEventMessageID is the message identifier for the event's message.
+	EventMetadataEventMessageID
+	// EventMetadataEventTemplate is the event's template, as an XML string.
+	EventMetadataEventTemplate
+)
+
+// An EventMetadataEnum is a Handle returned by EvtOpenEventMetadataEnum, used to
+// enumerate the event definitions a publisher supports.
+type EventMetadataEnum Handle
+
+// Close releases an EventMetadataEnum.
+func (h *EventMetadataEnum) Close() {
+	if h != nil {
+		wevtapi.EvtClose(h.handle)
+	}
+}
+
+// OpenPublisherMetadata opens a PublisherMetadata handle for the publisher
+// identified by name.
+//
+// Session is only required for remote connections; leave as nil for the local
+// computer. logfile may be empty unless the publisher's metadata resources are
+// only available in an archived .evtx file, in which case it names that file.
+// locale is an LCID (e.g. 0 to use the caller's current locale).
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtopenpublishermetadata
+func OpenPublisherMetadata(session *Session, name, logfile string, locale uint32) (*PublisherMetadata, error) {
+	pm := &PublisherMetadata{}
+
+	var s windows.Handle
+	if session != nil {
+		s = session.handle
+	}
+	var lf *uint16
+	if logfile != "" {
+		lf = windows.StringToUTF16Ptr(logfile)
+	}
+
+	var err error
+	pm.handle, err = wevtapi.EvtOpenPublisherMetadata(s, windows.StringToUTF16Ptr(name), lf, locale, 0)
+	if err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtOpenPublisherMetadata(%s): %w", name, err)
+	}
+	return pm, nil
+}
+
+// GetPublisherMetadataProperty retrieves a single property of pm, such as its
+// PublisherGuid, Levels, or Keywords array.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtgetpublishermetadataproperty
+func GetPublisherMetadataProperty(pm *PublisherMetadata, id EvtPublisherMetadataPropertyID) (EvtVariant, error) {
+	var bufferUsed uint32
+	err := wevtapi.EvtGetPublisherMetadataProperty(pm.handle, uint32(id), 0, 0, nil, &bufferUsed)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetPublisherMetadataProperty (probe): %w", err)
+	}
+
+	buf := make([]byte, bufferUsed)
+	if err := wevtapi.EvtGetPublisherMetadataProperty(pm.handle, uint32(id), 0, uint32(len(buf)), &buf[0], &bufferUsed); err != nil {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetPublisherMetadataProperty: %w", err)
+	}
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		return EvtVariant{}, err
+	}
+	return vs[0], nil
+}
+
+// OpenEventMetadataEnum begins an enumeration of the event definitions that
+// publisher pm declares (its manifest's <events> element).
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtopeneventmetadataenum
+func OpenEventMetadataEnum(pm *PublisherMetadata) (*EventMetadataEnum, error) {
+	e := &EventMetadataEnum{}
+	var err error
+	e.handle, err = wevtapi.EvtOpenEventMetadataEnum(pm.handle, 0)
+	if err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtOpenEventMetadataEnum: %w", err)
+	}
+	return e, nil
+}
+
+// An EventMetadata Handle describes a single event definition, as returned by
+// NextEventMetadata.
+type EventMetadata Handle
+
+// Close releases an EventMetadata handle.
+func (h *EventMetadata) Close() {
+	if h != nil {
+		wevtapi.EvtClose(h.handle)
+	}
+}
+
+// NextEventMetadata advances enum and returns the next event definition, or
+// windows.ERROR_NO_MORE_ITEMS once the enumeration is exhausted.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtnexteventmetadata
+func NextEventMetadata(enum *EventMetadataEnum) (*EventMetadata, error) {
+	em := &EventMetadata{}
+	var err error
+	em.handle, err = wevtapi.EvtNextEventMetadata(enum.handle, 0)
+	if err == windows.ERROR_NO_MORE_ITEMS {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtNextEventMetadata: %w", err)
+	}
+	return em, nil
+}
+
+// GetEventMetadataProperty retrieves a single property of em, such as its
+// EventID or Template.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtgeteventmetadataproperty
+func GetEventMetadataProperty(em *EventMetadata, id EvtEventMetadataPropertyID) (EvtVariant, error) {
+	var bufferUsed uint32
+	err := wevtapi.EvtGetEventMetadataProperty(em.handle, uint32(id), 0, 0, nil, &bufferUsed)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetEventMetadataProperty (probe): %w", err)
+	}
+
+	buf := make([]byte, bufferUsed)
+	if err := wevtapi.EvtGetEventMetadataProperty(em.handle, uint32(id), 0, uint32(len(buf)), &buf[0], &bufferUsed); err != nil {
+		return EvtVariant{}, fmt.Errorf("wevtapi.EvtGetEventMetadataProperty: %w", err)
+	}
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		return EvtVariant{}, err
+	}
+	return vs[0], nil
+}
+
+// publisherCacheKey identifies a cached PublisherMetadata handle.
+type publisherCacheKey struct {
+	name   string
+	locale uint32
+}
+
+// PublisherCache is a small in-process LRU cache of open PublisherMetadata
+// handles, keyed by (publisher name, locale). Resolving level/opcode/keyword/
+// channel names for every event in a high-volume log is the common
+// winlogbeat/OTel-collector workload, and reopening EvtOpenPublisherMetadata
+// per event is prohibitively expensive; callers should route lookups through
+// Get instead of calling OpenPublisherMetadata directly in a hot loop.
+type PublisherCache struct {
+	mu       sync.Mutex
+	maxItems int
+	ll       *list.List // of *publisherCacheEntry, most-recently-used at the front.
+	items    map[publisherCacheKey]*list.Element
+}
+
+type publisherCacheEntry struct {
+	key publisherCacheKey
+	pm  *PublisherMetadata
+}
+
+// defaultPublisherCacheSize bounds the number of distinct (publisher, locale)
+// handles NewPublisherCache keeps open at once.
+const defaultPublisherCacheSize = 64
+
+// NewPublisherCache creates an empty publisher metadata cache holding up to
+// maxItems entries. A maxItems of zero or less uses defaultPublisherCacheSize.
+func NewPublisherCache(maxItems int) *PublisherCache {
+	if maxItems <= 0 {
+		maxItems = defaultPublisherCacheSize
+	}
+	return &PublisherCache{
+		maxItems: maxItems,
+		ll:       list.New(),
+		items:    make(map[publisherCacheKey]*list.Element),
+	}
+}
+
+// Get returns the cached PublisherMetadata for (name, locale), opening and
+// caching it via OpenPublisherMetadata if not already present. The returned
+// handle is owned by the cache and must not be closed by the caller; it is
+// released when evicted or when Close is called on the cache.
+func (c *PublisherCache) Get(session *Session, name string, locale uint32) (*PublisherMetadata, error) {
+	key := publisherCacheKey{name: name, locale: locale}
+
+	c.mu.Lock()
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		pm := e.Value.(*publisherCacheEntry).pm
+		c.mu.Unlock()
+		return pm, nil
+	}
+	c.mu.Unlock()
+
+	pm, err := OpenPublisherMetadata(session, name, "", locale)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Another goroutine may have raced us to populate this key; prefer the
+	// existing entry and close the handle we just opened.
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		pm.Close()
+		return e.Value.(*publisherCacheEntry).pm, nil
+	}
+
+	e := c.ll.PushFront(&publisherCacheEntry{key: key, pm: pm})
+	c.items[key] = e
+	if c.ll.Len() > c.maxItems {
+		c.evictOldest()
+	}
+	return pm, nil
+}
+
+// evictOldest removes the least-recently-used entry. c.mu must be held.
+func (c *PublisherCache) evictOldest() {
+	e := c.ll.Back()
+	if e == nil {
+		return
+	}
+	c.ll.Remove(e)
+	entry := e.Value.(*publisherCacheEntry)
+	delete(c.items, entry.key)
+	entry.pm.Close()
+}
+
+// Close releases all cached PublisherMetadata handles.
+func (c *PublisherCache) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, e := range c.items {
+		e.Value.(*publisherCacheEntry).pm.Close()
+	}
+	c.ll.Init()
+	c.items = make(map[publisherCacheKey]*list.Element)
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import "testing"
+
+// newTestEntry inserts a cache entry directly, bypassing OpenPublisherMetadata
+// (and the real EvtOpenPublisherMetadata syscall it would make) so the LRU
+// bookkeeping can be exercised on its own. The entry's PublisherMetadata has a
+// zero handle, so evicting it still calls EvtClose, on that zero handle.
+func newTestEntry(c *PublisherCache, name string) {
+	key := publisherCacheKey{name: name}
+	e := c.ll.PushFront(&publisherCacheEntry{key: key, pm: &PublisherMetadata{}})
+	c.items[key] = e
+}
+
+func TestPublisherCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewPublisherCache(2)
+	newTestEntry(c, "a")
+	newTestEntry(c, "b")
+
+	if c.ll.Len() > c.maxItems {
+		c.evictOldest()
+	}
+	if _, ok := c.items[publisherCacheKey{name: "a"}]; !ok {
+		t.Fatalf("entry %q evicted before the cache was over capacity", "a")
+	}
+
+	newTestEntry(c, "c")
+	if c.ll.Len() > c.maxItems {
+		c.evictOldest()
+	}
+
+	if _, ok := c.items[publisherCacheKey{name: "a"}]; ok {
+		t.Errorf("least-recently-used entry %q was not evicted", "a")
+	}
+	if _, ok := c.items[publisherCacheKey{name: "b"}]; !ok {
+		t.Errorf("entry %q was evicted, want it kept", "b")
+	}
+	if _, ok := c.items[publisherCacheKey{name: "c"}]; !ok {
+		t.Errorf("entry %q was evicted, want it kept", "c")
+	}
+	if got := c.ll.Len(); got != c.maxItems {
+		t.Errorf("cache holds %d entries, want %d", got, c.maxItems)
+	}
+}
+
+func TestPublisherCacheGetPromotesOnHit(t *testing.T) {
+	c := NewPublisherCache(2)
+	newTestEntry(c, "a")
+	newTestEntry(c, "b")
+	// "b" was pushed most recently, so "a" is the least-recently-used of the
+	// two. Get("a") is a cache hit -- it must MoveToFront instead of just
+	// returning the entry, or "a" looks just as stale as before.
+	if _, err := c.Get(nil, "a", 0); err != nil {
+		t.Fatalf("Get(a): %v", err)
+	}
+
+	newTestEntry(c, "c")
+	if c.ll.Len() > c.maxItems {
+		c.evictOldest()
+	}
+
+	if _, ok := c.items[publisherCacheKey{name: "a"}]; !ok {
+		t.Errorf("entry %q touched by Get was evicted, want it kept", "a")
+	}
+	if _, ok := c.items[publisherCacheKey{name: "b"}]; ok {
+		t.Errorf("untouched entry %q was not evicted", "b")
+	}
+	if _, ok := c.items[publisherCacheKey{name: "c"}]; !ok {
+		t.Errorf("entry %q was evicted, want it kept", "c")
+	}
+}
+
+func TestNewPublisherCacheDefaultSize(t *testing.T) {
+	c := NewPublisherCache(0)
+	if c.maxItems != defaultPublisherCacheSize {
+		t.Errorf("maxItems = %d, want %d", c.maxItems, defaultPublisherCacheSize)
+	}
+}
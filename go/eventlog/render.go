@@ -0,0 +1,478 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"fmt"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"github.com/google/winops/winlog/wevtapi"
+)
+
+// A PublisherMetadata is a Handle to a registered event publisher's metadata,
+// as returned by OpenPublisherMetadata. It is used to resolve an event's
+// formatted message and to look up provider-specific schema information.
+type PublisherMetadata Handle
+
+// Close releases a PublisherMetadata.
+func (h *PublisherMetadata) Close() {
+	if h != nil {
+		wevtapi.EvtClose(h.handle)
+	}
+}
+
+// EvtRenderFlag specifies the type of values to render from an event.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_render_flags
+type EvtRenderFlag uint32
+
+const (
+	// EvtRenderEventValues renders the event as an array of EvtVariant, as specified by a RenderContext.
+	EvtRenderEventValues EvtRenderFlag = iota
+	// EvtRenderEventXml renders the event as an XML string.
+	EvtRenderEventXml
+	// EvtRenderBookmark renders a bookmark as an XML string.
+	EvtRenderBookmark
+)
+
+// arrayFlag (EVT_VARIANT_TYPE_ARRAY) is OR'd into an EVT_VARIANT's Type field to
+// indicate that its value is a pointer to a contiguous array of Count values,
+// rather than a single scalar value.
+const arrayFlag = 0x80
+
+// rawEvtVariant mirrors the in-memory layout of EVT_VARIANT on 64-bit Windows:
+// a 16-byte union (the widest member is the embedded SYSTEMTIME) followed by
+// two 4-byte fields, for 24 bytes total.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ns-winevt-evt_variant
+type rawEvtVariant struct {
+	data  [16]byte
+	count uint32
+	typ   uint32
+}
+
+// Render produces the set of values described by ctx (see CreateRenderContext)
+// from evt. flag must be EvtRenderEventValues; use RenderXML to render the
+// full event as XML instead.
+//
+// Render calls EvtRender twice: once to determine the required buffer size,
+// and again to fill a buffer of that size, as recommended by the Windows Event
+// Log API.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtrender
+func Render(ctx RenderContext, evt Event, flag EvtRenderFlag) ([]EvtVariant, error) {
+	var bufferUsed, propertyCount uint32
+	err := wevtapi.EvtRender(ctx.handle, evt.handle, uint32(flag), 0, nil, &bufferUsed, &propertyCount)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return nil, fmt.Errorf("wevtapi.EvtRender (probe): %w", err)
+	}
+	if propertyCount == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, bufferUsed)
+	if err := wevtapi.EvtRender(ctx.handle, evt.handle, uint32(flag), uint32(len(buf)), &buf[0], &bufferUsed, &propertyCount); err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtRender: %w", err)
+	}
+
+	return decodeVariants(buf, propertyCount)
+}
+
+// RenderXML renders the entirety of evt as an XML string, equivalent to the
+// "Details" -> "XML View" tab in Event Viewer.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtrender
+func RenderXML(evt Event) (string, error) {
+	var bufferUsed, propertyCount uint32
+	err := wevtapi.EvtRender(0, evt.handle, uint32(EvtRenderEventXml), 0, nil, &bufferUsed, &propertyCount)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return "", fmt.Errorf("wevtapi.EvtRender (probe): %w", err)
+	}
+
+	buf := make([]uint16, bufferUsed/2+1)
+	if err := wevtapi.EvtRender(0, evt.handle, uint32(EvtRenderEventXml), uint32(len(buf)*2), &buf[0], &bufferUsed, &propertyCount); err != nil {
+		return "", fmt.Errorf("wevtapi.EvtRender: %w", err)
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// decodeVariants walks a buffer filled by EvtRender(EvtRenderEventValues) as an
+// array of count EVT_VARIANT structures and decodes each into an EvtVariant.
+func decodeVariants(buf []byte, count uint32) ([]EvtVariant, error) {
+	const rawSize = unsafe.Sizeof(rawEvtVariant{})
+	if uint32(len(buf)) < count*uint32(rawSize) {
+		return nil, fmt.Errorf("buffer too small for %d EVT_VARIANT values: got %d bytes, want %d", count, len(buf), count*uint32(rawSize))
+	}
+
+	out := make([]EvtVariant, count)
+	for i := uint32(0); i < count; i++ {
+		raw := (*rawEvtVariant)(unsafe.Pointer(&buf[uintptr(i)*rawSize]))
+		v, err := decodeVariant(raw)
+		if err != nil {
+			return nil, fmt.Errorf("decodeVariant[%d]: %w", i, err)
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+// decodeVariant decodes a single EVT_VARIANT based on its Type field, including
+// the array-flag bit which indicates that the union holds a pointer to Count
+// contiguous values rather than a single scalar.
+func decodeVariant(raw *rawEvtVariant) (EvtVariant, error) {
+	isArray := raw.typ&arrayFlag != 0
+	typ := EvtVariantType(raw.typ &^ arrayFlag)
+
+	v := EvtVariant{Count: raw.count, Type: typ}
+	if raw.count == 0 && isArray {
+		return v, nil
+	}
+
+	switch typ {
+	case EvtVarTypeNull:
+		// No value.
+	case EvtVarTypeString:
+		if isArray {
+			v.Data.StringArr = decodeStringArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.StringVal = windows.UTF16PtrToString((*uint16)(ptrOf(raw)))
+		}
+	case EvtVarTypeAnsiString:
+		if isArray {
+			v.Data.AnsiStringArr = decodeAnsiStringArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.AnsiStringVal = decodeAnsiString(ptrOf(raw))
+		}
+	case EvtVarTypeSByte:
+		if isArray {
+			v.Data.SByteArr = derefArray[int8](ptrOf(raw), raw.count)
+		} else {
+			v.Data.SByteVal = int8(raw.data[0])
+		}
+	case EvtVarTypeByte:
+		if isArray {
+			v.Data.ByteArr = decodeByteArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.ByteVal = raw.data[0]
+		}
+	case EvtVarTypeInt16:
+		if isArray {
+			v.Data.Int16Arr = derefArray[int16](ptrOf(raw), raw.count)
+		} else {
+			v.Data.Int16Val = *(*int16)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeUInt16:
+		if isArray {
+			v.Data.UInt16Arr = derefArray[uint16](ptrOf(raw), raw.count)
+		} else {
+			v.Data.UInt16Val = *(*uint16)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeInt32:
+		if isArray {
+			v.Data.Int32Arr = derefArray[int32](ptrOf(raw), raw.count)
+		} else {
+			v.Data.Int32Val = *(*int32)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeUInt32, EvtVarTypeHexInt32:
+		if isArray {
+			v.Data.UInt32Arr = derefArray[uint32](ptrOf(raw), raw.count)
+		} else {
+			v.Data.UInt32Val = *(*uint32)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeInt64:
+		if isArray {
+			v.Data.Int64Arr = derefArray[int64](ptrOf(raw), raw.count)
+		} else {
+			v.Data.Int64Val = *(*int64)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeUInt64, EvtVarTypeHexInt64:
+		if isArray {
+			v.Data.UInt64Arr = derefArray[uint64](ptrOf(raw), raw.count)
+		} else {
+			v.Data.UInt64Val = *(*uint64)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeSingle:
+		if isArray {
+			v.Data.SingleArr = derefArray[float32](ptrOf(raw), raw.count)
+		} else {
+			v.Data.SingleVal = *(*float32)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeDouble:
+		if isArray {
+			v.Data.DoubleArr = derefArray[float64](ptrOf(raw), raw.count)
+		} else {
+			v.Data.DoubleVal = *(*float64)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeBoolean:
+		if isArray {
+			v.Data.BooleanArr = decodeBoolArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.BooleanVal = *(*int32)(unsafe.Pointer(&raw.data[0])) != 0
+		}
+	case EvtVarTypeBinary:
+		// BinaryVal is a byte array of Count bytes, regardless of the array flag.
+		if b := derefArray[byte](ptrOf(raw), raw.count); b != nil {
+			v.Data.BinaryVal = *b
+		}
+	case EvtVarTypeGuid:
+		if isArray {
+			v.Data.GuidArr = derefArray[windows.GUID](ptrOf(raw), raw.count)
+		} else if p := (*windows.GUID)(ptrOf(raw)); p != nil {
+			v.Data.GuidVal = *p
+		}
+	case EvtVarTypeSizeT:
+		if isArray {
+			v.Data.SizeTArr = decodeSizeTArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.SizeTVal = uint32(*(*uintptr)(unsafe.Pointer(&raw.data[0])))
+		}
+	case EvtVarTypeFileTime:
+		if isArray {
+			v.Data.FileTimeArr = derefArray[windows.Filetime](ptrOf(raw), raw.count)
+		} else {
+			v.Data.FileTimeVal = *(*windows.Filetime)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeSysTime:
+		if isArray {
+			v.Data.SysTimeArr = derefArray[windows.Systemtime](ptrOf(raw), raw.count)
+		} else {
+			v.Data.SysTimeVal = *(*windows.Systemtime)(unsafe.Pointer(&raw.data[0]))
+		}
+	case EvtVarTypeSid:
+		if isArray {
+			v.Data.SidArr = decodeSidArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.SidVal = (*windows.SID)(ptrOf(raw))
+		}
+	case EvtVarTypeEvtHandle:
+		v.Data.EvtHandleVal = *(*windows.Handle)(unsafe.Pointer(&raw.data[0]))
+	case EvtVarTypeEvtXml:
+		if isArray {
+			v.Data.XmlValArr = decodeStringArray(ptrOf(raw), raw.count)
+		} else {
+			v.Data.XmlVal = windows.UTF16PtrToString((*uint16)(ptrOf(raw)))
+		}
+	default:
+		return v, fmt.Errorf("unsupported EVT_VARIANT type %d", typ)
+	}
+	return v, nil
+}
+
+// ptrOf returns the pointer stored in the first 8 bytes of raw's union, or nil
+// if it is zero.
+//
+// The union is reinterpreted directly as unsafe.Pointer rather than read as a
+// uintptr and converted back: go vet's unsafeptr check flags a uintptr ->
+// unsafe.Pointer conversion unless the uintptr came from pointer arithmetic
+// in the same expression, which an integer loaded from a raw byte buffer
+// never does.
+func ptrOf(raw *rawEvtVariant) unsafe.Pointer {
+	return *(*unsafe.Pointer)(unsafe.Pointer(&raw.data[0]))
+}
+
+// derefArray reinterprets the count values of type T starting at base as a Go
+// slice. It returns nil if base is nil or count is zero.
+func derefArray[T any](base unsafe.Pointer, count uint32) *[]T {
+	if base == nil || count == 0 {
+		return nil
+	}
+	out := make([]T, count)
+	size := unsafe.Sizeof(out[0])
+	for i := uint32(0); i < count; i++ {
+		out[i] = *(*T)(unsafe.Pointer(uintptr(base) + uintptr(i)*size))
+	}
+	return &out
+}
+
+// derefPtrArray reinterprets the count pointer-sized values starting at base
+// as a []unsafe.Pointer, for arrays of PSID/LPCWSTR/LPCSTR pointers that the
+// caller still needs to dereference. It returns nil if base is nil or count
+// is zero.
+//
+// Unlike derefArray[uintptr], this keeps every element typed as
+// unsafe.Pointer instead of uintptr: converting a uintptr read back out of a
+// slice into unsafe.Pointer later trips go vet's unsafeptr check, since by
+// then it is no longer derived from pointer arithmetic in the same
+// expression.
+func derefPtrArray(base unsafe.Pointer, count uint32) []unsafe.Pointer {
+	if base == nil || count == 0 {
+		return nil
+	}
+	out := make([]unsafe.Pointer, count)
+	for i := uint32(0); i < count; i++ {
+		out[i] = *(*unsafe.Pointer)(unsafe.Pointer(uintptr(base) + uintptr(i)*unsafe.Sizeof(out[0])))
+	}
+	return out
+}
+
+// decodeBoolArray decodes a contiguous array of count Win32 BOOL (int32) values
+// starting at base into a []bool.
+func decodeBoolArray(base unsafe.Pointer, count uint32) *[]bool {
+	ints := derefArray[int32](base, count)
+	if ints == nil {
+		return nil
+	}
+	out := make([]bool, len(*ints))
+	for i, b := range *ints {
+		out[i] = b != 0
+	}
+	return &out
+}
+
+// decodeByteArray decodes a contiguous array of count UINT8 values (1-byte
+// stride) starting at base, widening each into the pre-existing []uint16
+// ByteArr field.
+func decodeByteArray(base unsafe.Pointer, count uint32) *[]uint16 {
+	bytes := derefArray[byte](base, count)
+	if bytes == nil {
+		return nil
+	}
+	out := make([]uint16, len(*bytes))
+	for i, b := range *bytes {
+		out[i] = uint16(b)
+	}
+	return &out
+}
+
+// decodeSizeTArray decodes a contiguous array of count SIZE_T values
+// (uintptr-width, 8 bytes on 64-bit Windows) starting at base, narrowing each
+// into the pre-existing []uint32 SizeTArr field, mirroring how the scalar
+// EvtVarTypeSizeT case narrows after reading a full uintptr.
+func decodeSizeTArray(base unsafe.Pointer, count uint32) *[]uint32 {
+	vals := derefArray[uintptr](base, count)
+	if vals == nil {
+		return nil
+	}
+	out := make([]uint32, len(*vals))
+	for i, sz := range *vals {
+		out[i] = uint32(sz)
+	}
+	return &out
+}
+
+// decodeSidArray decodes a contiguous array of count PSID pointers starting at
+// base into a []*windows.SID. Each element points into the render buffer
+// rather than a copy, since windows.SID is an opaque, variable-length type.
+func decodeSidArray(base unsafe.Pointer, count uint32) *[]*windows.SID {
+	ptrs := derefPtrArray(base, count)
+	if ptrs == nil {
+		return nil
+	}
+	out := make([]*windows.SID, len(ptrs))
+	for i, p := range ptrs {
+		out[i] = (*windows.SID)(p)
+	}
+	return &out
+}
+
+// decodeStringArray decodes a contiguous array of count LPCWSTR pointers
+// starting at base into a []string.
+func decodeStringArray(base unsafe.Pointer, count uint32) *[]string {
+	ptrs := derefPtrArray(base, count)
+	if ptrs == nil {
+		return nil
+	}
+	out := make([]string, len(ptrs))
+	for i, p := range ptrs {
+		if p != nil {
+			out[i] = windows.UTF16PtrToString((*uint16)(p))
+		}
+	}
+	return &out
+}
+
+// decodeAnsiString decodes a NUL-terminated ANSI string starting at base.
+func decodeAnsiString(base unsafe.Pointer) string {
+	if base == nil {
+		return ""
+	}
+	var b []byte
+	for i := uintptr(0); ; i++ {
+		c := *(*byte)(unsafe.Pointer(uintptr(base) + i))
+		if c == 0 {
+			break
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// decodeAnsiStringArray decodes a contiguous array of count LPCSTR pointers
+// starting at base into a []string.
+func decodeAnsiStringArray(base unsafe.Pointer, count uint32) *[]string {
+	ptrs := derefPtrArray(base, count)
+	if ptrs == nil {
+		return nil
+	}
+	out := make([]string, len(ptrs))
+	for i, p := range ptrs {
+		if p != nil {
+			out[i] = decodeAnsiString(p)
+		}
+	}
+	return &out
+}
+
+// EvtFormatMessageFlag selects which part of a publisher's message resources
+// FormatMessage should return for an event.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/ne-winevt-evt_format_message_flags
+type EvtFormatMessageFlag uint32
+
+const (
+	// EvtFormatMessageEvent formats the event's message string.
+	EvtFormatMessageEvent EvtFormatMessageFlag = iota + 1
+	// EvtFormatMessageLevel formats the event's level string.
+	EvtFormatMessageLevel
+	// EvtFormatMessageTask formats the event's task string.
+	EvtFormatMessageTask
+	// EvtFormatMessageOpcode formats the event's opcode string.
+	EvtFormatMessageOpcode
+	// EvtFormatMessageKeyword formats the event's keyword strings.
+	EvtFormatMessageKeyword
+	// EvtFormatMessageChannel formats the event's channel string.
+	EvtFormatMessageChannel
+	// EvtFormatMessageProvider formats the event's provider name.
+	EvtFormatMessageProvider
+	// EvtFormatMessageId formats the message identified by a resource ID.
+	EvtFormatMessageId
+	// EvtFormatMessageXml formats the entirety of the event as XML, with message strings substituted in.
+	EvtFormatMessageXml
+)
+
+// FormatMessage formats one of evt's message strings (selected by flag) using
+// the message table resources registered by publisher.
+//
+// Like Render, it calls EvtFormatMessage twice: once to size the buffer, once
+// to fill it.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtformatmessage
+func FormatMessage(publisher PublisherMetadata, evt Event, flag EvtFormatMessageFlag) (string, error) {
+	var bufferUsed uint32
+	err := wevtapi.EvtFormatMessage(publisher.handle, evt.handle, 0, 0, nil, uint32(flag), 0, nil, &bufferUsed)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return "", fmt.Errorf("wevtapi.EvtFormatMessage (probe): %w", err)
+	}
+	if bufferUsed == 0 {
+		return "", nil
+	}
+
+	buf := make([]uint16, bufferUsed)
+	if err := wevtapi.EvtFormatMessage(publisher.handle, evt.handle, 0, 0, nil, uint32(flag), uint32(len(buf)), &buf[0], &bufferUsed); err != nil {
+		return "", fmt.Errorf("wevtapi.EvtFormatMessage: %w", err)
+	}
+	return windows.UTF16ToString(buf), nil
+}
@@ -0,0 +1,169 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// rawVariantBuf lays out a single rawEvtVariant as EvtRender would, with ptr
+// (if non-nil) stored in the union's first 8 bytes.
+func rawVariantBuf(typ uint32, count uint32, ptr unsafe.Pointer) []byte {
+	buf := make([]byte, unsafe.Sizeof(rawEvtVariant{}))
+	raw := (*rawEvtVariant)(unsafe.Pointer(&buf[0]))
+	raw.count = count
+	raw.typ = typ
+	if ptr != nil {
+		*(*uintptr)(unsafe.Pointer(&raw.data[0])) = uintptr(ptr)
+	}
+	return buf
+}
+
+func TestDecodeVariantsUInt32(t *testing.T) {
+	buf := rawVariantBuf(uint32(EvtVarTypeUInt32), 0, nil)
+	*(*uint32)(unsafe.Pointer(&buf[0])) = 42
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	if got := vs[0].Data.UInt32Val; got != 42 {
+		t.Errorf("UInt32Val = %d, want 42", got)
+	}
+}
+
+func TestDecodeVariantsSidIsNotCopied(t *testing.T) {
+	// A SID is opaque to Go, so stand in a recognizable byte pattern and check
+	// it survives decoding as a pointer rather than being zeroed out by a
+	// value copy of the zero-size windows.SID marker type.
+	sidBytes := []byte{1, 1, 0, 0, 0, 0, 0, 5, 32, 0, 0, 0, 32, 2, 0, 0}
+	buf := rawVariantBuf(uint32(EvtVarTypeSid), 0, unsafe.Pointer(&sidBytes[0]))
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	got := vs[0].Data.SidVal
+	if got == nil {
+		t.Fatal("SidVal = nil, want a pointer into sidBytes")
+	}
+	if unsafe.Pointer(got) != unsafe.Pointer(&sidBytes[0]) {
+		t.Errorf("SidVal points at %p, want %p", got, &sidBytes[0])
+	}
+}
+
+func TestDecodeVariantsBinary(t *testing.T) {
+	want := []byte{0xde, 0xad, 0xbe, 0xef, 0x01}
+	buf := rawVariantBuf(uint32(EvtVarTypeBinary), uint32(len(want)), unsafe.Pointer(&want[0]))
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	got := vs[0].Data.BinaryVal
+	if len(got) != len(want) {
+		t.Fatalf("BinaryVal = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("BinaryVal[%d] = %#x, want %#x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeVariantsByteArray(t *testing.T) {
+	// The trailing three bytes stand in for whatever follows the array in a
+	// real EvtRender buffer: ByteArr's stride must be 1, not 2, or decoding
+	// would overread into them and scramble the real values.
+	data := []byte{0x11, 0x22, 0x33, 0xaa, 0xaa, 0xaa}
+	buf := rawVariantBuf(uint32(EvtVarTypeByte)|arrayFlag, 3, unsafe.Pointer(&data[0]))
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	if vs[0].Data.ByteArr == nil {
+		t.Fatal("ByteArr = nil")
+	}
+	got := *vs[0].Data.ByteArr
+	want := []uint16{0x11, 0x22, 0x33}
+	if len(got) != len(want) {
+		t.Fatalf("ByteArr = %#v, want %#v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ByteArr[%d] = %#x, want %#x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeVariantsSizeTArray(t *testing.T) {
+	// SIZE_T is uintptr-width (8 bytes on 64-bit Windows), not uint32; reading
+	// these values with a 4-byte stride would yield {1, 0, 2} instead.
+	vals := []uintptr{1, 2, 0xffffffff}
+	buf := rawVariantBuf(uint32(EvtVarTypeSizeT)|arrayFlag, uint32(len(vals)), unsafe.Pointer(&vals[0]))
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	if vs[0].Data.SizeTArr == nil {
+		t.Fatal("SizeTArr = nil")
+	}
+	got := *vs[0].Data.SizeTArr
+	want := []uint32{1, 2, 0xffffffff}
+	if len(got) != len(want) {
+		t.Fatalf("SizeTArr = %#v, want %#v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("SizeTArr[%d] = %#x, want %#x", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecodeVariantsStringArray(t *testing.T) {
+	a, err := windows.UTF16PtrFromString("alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := windows.UTF16PtrFromString("beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ptrs := []uintptr{uintptr(unsafe.Pointer(a)), uintptr(unsafe.Pointer(b))}
+	buf := rawVariantBuf(uint32(EvtVarTypeString)|arrayFlag, uint32(len(ptrs)), unsafe.Pointer(&ptrs[0]))
+
+	vs, err := decodeVariants(buf, 1)
+	if err != nil {
+		t.Fatalf("decodeVariants: %v", err)
+	}
+	if vs[0].Data.StringArr == nil {
+		t.Fatal("StringArr = nil")
+	}
+	got := *vs[0].Data.StringArr
+	want := []string{"alpha", "beta"}
+	if len(got) != len(want) {
+		t.Fatalf("StringArr = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("StringArr[%d] = %q, want %q", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2021 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventlog
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+	"github.com/google/winops/winlog/wevtapi"
+)
+
+// A Bookmark is a Handle that tracks the position of the last event read from a
+// channel or log file, so that a subsequent Subscribe can resume from that point.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/wes/bookmarking-events
+type Bookmark Handle
+
+// Close releases a Bookmark.
+func (b *Bookmark) Close() {
+	if b != nil {
+		wevtapi.EvtClose(b.handle)
+	}
+}
+
+// NewBookmark creates an empty Bookmark, suitable for use with Subscribe to start
+// receiving events from the current point forward.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtcreatebookmark
+func NewBookmark() (*Bookmark, error) {
+	return bookmarkFromXML("")
+}
+
+// bookmarkFromXML wraps EvtCreateBookmark, which accepts either an empty string
+// (to create a fresh bookmark) or a previously rendered bookmark XML fragment
+// (to resume from a saved position).
+func bookmarkFromXML(bookmarkXML string) (*Bookmark, error) {
+	b := &Bookmark{}
+
+	var ptr *uint16
+	if bookmarkXML != "" {
+		p, err := syscall.UTF16PtrFromString(bookmarkXML)
+		if err != nil {
+			return nil, fmt.Errorf("syscall.UTF16PtrFromString(%s): %w", bookmarkXML, err)
+		}
+		ptr = p
+	}
+
+	var err error
+	b.handle, err = wevtapi.EvtCreateBookmark(ptr)
+	if err != nil {
+		return nil, fmt.Errorf("wevtapi.EvtCreateBookmark: %w", err)
+	}
+	return b, nil
+}
+
+// Update advances the Bookmark to the position of evt, so that a subsequent
+// render of the bookmark will resume from evt on the next Subscribe.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtupdatebookmark
+func (b *Bookmark) Update(evt Event) error {
+	if err := wevtapi.EvtUpdateBookmark(b.handle, evt.handle); err != nil {
+		return fmt.Errorf("wevtapi.EvtUpdateBookmark: %w", err)
+	}
+	return nil
+}
+
+// render produces the bookmark's current XML representation by probing for the
+// required buffer size and then rendering into a buffer of that size.
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtrender
+func (b *Bookmark) render() (string, error) {
+	var bufferUsed, propertyCount uint32
+	err := wevtapi.EvtRender(0, b.handle, wevtapi.EvtRenderBookmark, 0, nil, &bufferUsed, &propertyCount)
+	if err != nil && err != windows.ERROR_INSUFFICIENT_BUFFER {
+		return "", fmt.Errorf("wevtapi.EvtRender (probe): %w", err)
+	}
+
+	buf := make([]uint16, bufferUsed/2+1)
+	if err := wevtapi.EvtRender(0, b.handle, wevtapi.EvtRenderBookmark, uint32(len(buf)*2), &buf[0], &bufferUsed, &propertyCount); err != nil {
+		return "", fmt.Errorf("wevtapi.EvtRender: %w", err)
+	}
+	return windows.UTF16ToString(buf), nil
+}
+
+// MarshalXML implements xml.Marshaler, allowing a Bookmark to be persisted
+// (e.g. to disk) as part of a larger document and later restored with
+// UnmarshalXML to resume a Subscribe from the last-seen event.
+func (b *Bookmark) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	raw, err := b.render()
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(raw, start)
+}
+
+// UnmarshalXML implements xml.Unmarshaler, restoring a Bookmark from XML
+// previously produced by MarshalXML.
+func (b *Bookmark) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var raw string
+	if err := d.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	restored, err := bookmarkFromXML(raw)
+	if err != nil {
+		return err
+	}
+	*b = *restored
+	return nil
+}
+
+// A Subscription delivers events pushed from a channel or log file as they
+// occur, in contrast to the pull-based Query/Next pair. It is implemented in
+// pull mode: EvtSubscribe is given a signal event rather than a callback, and
+// a background goroutine waits on that event and drains available events with
+// Next, forwarding them on Events().
+//
+// Close() must be called to release the subscription and stop the background
+// goroutine once the caller is done.
+type Subscription struct {
+	handle ResultSet
+	signal windows.Handle
+
+	events chan Event
+	errs   chan error
+	stop   chan struct{}
+	wg     sync.WaitGroup
+
+	closeOnce sync.Once
+}
+
+// Events returns the channel on which subscribed events are delivered.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Errors returns the channel on which subscription errors are delivered.
+// A caller that observes an error should still drain Events() until it is
+// closed, since Close() is required to release the underlying handles.
+func (s *Subscription) Errors() <-chan error {
+	return s.errs
+}
+
+// Close stops the subscription's background goroutine and releases its
+// handles. It is safe to call more than once, including concurrently.
+func (s *Subscription) Close() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(s.close)
+}
+
+func (s *Subscription) close() {
+	close(s.stop)
+	s.wg.Wait()
+	windows.CloseHandle(s.signal)
+	s.handle.Close()
+}
+
+// Subscribe begins a push-mode subscription to a channel or log file, starting
+// at the position recorded in bookmark. If bookmark is nil, flags must include
+// wevtapi.EvtSubscribeToFutureEvents or wevtapi.EvtSubscribeStartAtOldestRecord
+// to tell Windows where to start.
+//
+// Session is only required for remote connections; leave as nil for the local
+// log. The caller must call Close() on the returned Subscription once done
+// reading from Events()/Errors().
+//
+// Ref: https://docs.microsoft.com/en-us/windows/win32/api/winevt/nf-winevt-evtsubscribe
+func Subscribe(session *Session, channel, query string, bookmark *Bookmark, flags uint32) (*Subscription, error) {
+	signal, err := windows.CreateEvent(nil, 0, 0, nil)
+	if err != nil {
+		return nil, fmt.Errorf("windows.CreateEvent: %w", err)
+	}
+
+	var s windows.Handle
+	if session != nil {
+		s = session.handle
+	}
+	var bm windows.Handle
+	if bookmark != nil {
+		bm = bookmark.handle
+	}
+
+	handle, err := wevtapi.EvtSubscribe(
+		s,
+		signal,
+		windows.StringToUTF16Ptr(channel),
+		windows.StringToUTF16Ptr(query),
+		bm,
+		0, // Context, unused in pull mode.
+		0, // Callback, unused in pull mode.
+		flags)
+	if err != nil {
+		windows.CloseHandle(signal)
+		return nil, fmt.Errorf("wevtapi.EvtSubscribe: %w", err)
+	}
+
+	sub := &Subscription{
+		handle: ResultSet{handle: handle},
+		signal: signal,
+		events: make(chan Event),
+		errs:   make(chan error),
+		stop:   make(chan struct{}),
+	}
+
+	sub.wg.Add(1)
+	go sub.run()
+
+	return sub, nil
+}
+
+// run waits on the subscription's signal event and drains available events
+// into Events() until Close() is called.
+func (s *Subscription) run() {
+	defer s.wg.Done()
+	defer close(s.events)
+	defer close(s.errs)
+
+	for {
+		waited, err := windows.WaitForSingleObject(s.signal, 1000)
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if err != nil {
+			s.sendErr(fmt.Errorf("windows.WaitForSingleObject: %w", err))
+			return
+		}
+		if waited == uint32(windows.WAIT_TIMEOUT) {
+			continue
+		}
+
+		for {
+			es, err := Next(s.handle, 1, nil)
+			if err == windows.ERROR_NO_MORE_ITEMS {
+				break
+			}
+			if err != nil {
+				s.sendErr(fmt.Errorf("eventlog.Next: %w", err))
+				break
+			}
+			for _, evt := range es.Events {
+				select {
+				case s.events <- evt:
+				case <-s.stop:
+					evt.Close()
+					return
+				}
+			}
+		}
+	}
+}
+
+// sendErr forwards err on Errors(), but gives up rather than blocking forever
+// if Close() has been called and nothing is draining the channel.
+func (s *Subscription) sendErr(err error) {
+	select {
+	case s.errs <- err:
+	case <-s.stop:
+	}
+}